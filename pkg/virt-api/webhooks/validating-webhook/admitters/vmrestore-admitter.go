@@ -0,0 +1,175 @@
+/*
+ * This file is part of the KubeVirt project
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ *
+ * Copyright 2018 Red Hat, Inc.
+ *
+ */
+
+package admitters
+
+import (
+	"encoding/json"
+	"fmt"
+
+	admissionv1 "k8s.io/api/admission/v1"
+	"k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	k8sfield "k8s.io/apimachinery/pkg/util/validation/field"
+
+	vmsnapshotv1alpha1 "kubevirt.io/client-go/apis/snapshot/v1alpha1"
+	"kubevirt.io/client-go/kubecli"
+	webhookutils "kubevirt.io/kubevirt/pkg/util/webhooks"
+	"kubevirt.io/kubevirt/pkg/virt-controller/snapshot/validation"
+)
+
+// VMRestoreAdmitter validates VirtualMachineRestores
+type VMRestoreAdmitter struct {
+	Client kubecli.KubevirtClient
+}
+
+// NewVMRestoreAdmitter creates a VMRestoreAdmitter
+func NewVMRestoreAdmitter(client kubecli.KubevirtClient) *VMRestoreAdmitter {
+	return &VMRestoreAdmitter{
+		Client: client,
+	}
+}
+
+// Admit validates an AdmissionReview
+func (admitter *VMRestoreAdmitter) Admit(ar *admissionv1.AdmissionReview) *admissionv1.AdmissionResponse {
+	if ar.Request.Resource.Group != vmsnapshotv1alpha1.SchemeGroupVersion.Group ||
+		ar.Request.Resource.Resource != "virtualmachinerestores" {
+		return webhookutils.ToAdmissionResponseError(fmt.Errorf("Unexpected Resource %+v", ar.Request.Resource))
+	}
+
+	vmRestore := &vmsnapshotv1alpha1.VirtualMachineRestore{}
+	// TODO ideally use UniversalDeserializer here
+	err := json.Unmarshal(ar.Request.Object.Raw, vmRestore)
+	if err != nil {
+		return webhookutils.ToAdmissionResponseError(err)
+	}
+
+	var causes []metav1.StatusCause
+
+	switch ar.Request.Operation {
+	case admissionv1.Create:
+		specField := k8sfield.NewPath("spec")
+
+		if ar.Request.DryRun != nil && *ar.Request.DryRun {
+			// skip the live snapshot/VM lookups so dry-run apply plans don't fail
+			// against objects that may not exist yet in the same apply
+			break
+		}
+
+		causes, err = admitter.validateSnapshotReady(specField.Child("virtualMachineSnapshotName"), ar.Request.Namespace, vmRestore.Spec.VirtualMachineSnapshotName)
+		if err != nil {
+			return webhookutils.ToAdmissionResponseError(err)
+		}
+
+		targetCauses, err := admitter.validateTargetNotRunning(specField.Child("target"), ar.Request.Namespace, vmRestore.Spec.Target)
+		if err != nil {
+			return webhookutils.ToAdmissionResponseError(err)
+		}
+		causes = append(causes, targetCauses...)
+	case admissionv1.Update:
+		prevObj := &vmsnapshotv1alpha1.VirtualMachineRestore{}
+		err = json.Unmarshal(ar.Request.OldObject.Raw, prevObj)
+		if err != nil {
+			return webhookutils.ToAdmissionResponseError(err)
+		}
+
+		causes = validation.ValidateSpecImmutable(&prevObj.Spec, &vmRestore.Spec, "spec is immutable after creation")
+	default:
+		return webhookutils.ToAdmissionResponseError(fmt.Errorf("unexpected operation %s", ar.Request.Operation))
+	}
+
+	if len(causes) > 0 {
+		return webhookutils.ToAdmissionResponse(causes)
+	}
+
+	reviewResponse := admissionv1.AdmissionResponse{
+		Allowed: true,
+	}
+	return &reviewResponse
+}
+
+func (admitter *VMRestoreAdmitter) validateSnapshotReady(field *k8sfield.Path, namespace, name string) ([]metav1.StatusCause, error) {
+	vmSnapshot, err := admitter.Client.VirtualMachineSnapshot(namespace).Get(name, &metav1.GetOptions{})
+	if errors.IsNotFound(err) {
+		return []metav1.StatusCause{
+			{
+				Type:    metav1.CauseTypeFieldValueInvalid,
+				Message: fmt.Sprintf("VirtualMachineSnapshot %q does not exist", name),
+				Field:   field.String(),
+			},
+		}, nil
+	}
+
+	if err != nil {
+		return nil, err
+	}
+
+	if vmSnapshot.Status == nil || vmSnapshot.Status.Phase != vmsnapshotv1alpha1.Ready {
+		return []metav1.StatusCause{
+			{
+				Type:    metav1.CauseTypeFieldValueInvalid,
+				Message: fmt.Sprintf("VirtualMachineSnapshot %q is not ready", name),
+				Field:   field.String(),
+			},
+		}, nil
+	}
+
+	return nil, nil
+}
+
+// validateTargetNotRunning ensures the VM a restore would overwrite, whether a brand new
+// name or the snapshot's original source VM, is not currently running.
+func (admitter *VMRestoreAdmitter) validateTargetNotRunning(field *k8sfield.Path, namespace string, target vmsnapshotv1alpha1.VirtualMachineRestoreTarget) ([]metav1.StatusCause, error) {
+	name := target.NewVMName
+	if name == nil {
+		name = target.VirtualMachineName
+	}
+
+	if name == nil {
+		return []metav1.StatusCause{
+			{
+				Type:    metav1.CauseTypeFieldValueNotFound,
+				Message: "missing restore target",
+				Field:   field.String(),
+			},
+		}, nil
+	}
+
+	vm, err := admitter.Client.VirtualMachine(namespace).Get(*name, &metav1.GetOptions{})
+	if errors.IsNotFound(err) {
+		// restoring into a brand new VM name is allowed
+		return nil, nil
+	}
+
+	if err != nil {
+		return nil, err
+	}
+
+	if vm.Spec.Running != nil && *vm.Spec.Running {
+		return []metav1.StatusCause{
+			{
+				Type:    metav1.CauseTypeFieldValueInvalid,
+				Message: fmt.Sprintf("VirtualMachine %q is running", *name),
+				Field:   field.String(),
+			},
+		}, nil
+	}
+
+	return nil, nil
+}
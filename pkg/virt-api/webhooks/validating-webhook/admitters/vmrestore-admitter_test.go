@@ -0,0 +1,114 @@
+/*
+ * This file is part of the KubeVirt project
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ *
+ * Copyright 2018 Red Hat, Inc.
+ *
+ */
+
+package admitters
+
+import (
+	"testing"
+
+	"github.com/golang/mock/gomock"
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+
+	"k8s.io/apimachinery/pkg/api/errors"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	k8sfield "k8s.io/apimachinery/pkg/util/validation/field"
+
+	kubevirtv1 "kubevirt.io/client-go/api/v1"
+	vmsnapshotv1alpha1 "kubevirt.io/client-go/apis/snapshot/v1alpha1"
+	"kubevirt.io/client-go/kubecli"
+)
+
+func TestAdmitters(t *testing.T) {
+	RegisterFailHandler(Fail)
+	RunSpecs(t, "Snapshot admitters Suite")
+}
+
+var _ = Describe("VMRestoreAdmitter", func() {
+	var (
+		ctrl          *gomock.Controller
+		client        *kubecli.MockKubevirtClient
+		vmInterface   *kubecli.MockVirtualMachineInterface
+		snapInterface *kubecli.MockVirtualMachineSnapshotInterface
+		admitter      *VMRestoreAdmitter
+	)
+
+	BeforeEach(func() {
+		ctrl = gomock.NewController(GinkgoT())
+		client = kubecli.NewMockKubevirtClient(ctrl)
+		vmInterface = kubecli.NewMockVirtualMachineInterface(ctrl)
+		snapInterface = kubecli.NewMockVirtualMachineSnapshotInterface(ctrl)
+		client.EXPECT().VirtualMachine(gomock.Any()).Return(vmInterface).AnyTimes()
+		client.EXPECT().VirtualMachineSnapshot(gomock.Any()).Return(snapInterface).AnyTimes()
+		admitter = &VMRestoreAdmitter{Client: client}
+	})
+
+	AfterEach(func() {
+		ctrl.Finish()
+	})
+
+	Context("validateSnapshotReady", func() {
+		field := k8sfield.NewPath("spec", "virtualMachineSnapshotName")
+
+		It("rejects a snapshot that is not Ready", func() {
+			snapInterface.EXPECT().Get("my-snapshot", gomock.Any()).Return(&vmsnapshotv1alpha1.VirtualMachineSnapshot{
+				Status: &vmsnapshotv1alpha1.VirtualMachineSnapshotStatus{Phase: vmsnapshotv1alpha1.InProgress},
+			}, nil)
+
+			causes, err := admitter.validateSnapshotReady(field, "default", "my-snapshot")
+			Expect(err).ToNot(HaveOccurred())
+			Expect(causes).To(HaveLen(1))
+		})
+
+		It("allows a snapshot that is Ready", func() {
+			snapInterface.EXPECT().Get("my-snapshot", gomock.Any()).Return(&vmsnapshotv1alpha1.VirtualMachineSnapshot{
+				Status: &vmsnapshotv1alpha1.VirtualMachineSnapshotStatus{Phase: vmsnapshotv1alpha1.Ready},
+			}, nil)
+
+			causes, err := admitter.validateSnapshotReady(field, "default", "my-snapshot")
+			Expect(err).ToNot(HaveOccurred())
+			Expect(causes).To(BeEmpty())
+		})
+	})
+
+	Context("validateTargetNotRunning", func() {
+		field := k8sfield.NewPath("spec", "target")
+
+		It("rejects restoring onto a running VM", func() {
+			running := true
+			vmInterface.EXPECT().Get("my-vm", gomock.Any()).Return(&kubevirtv1.VirtualMachine{
+				Spec: kubevirtv1.VirtualMachineSpec{Running: &running},
+			}, nil)
+
+			name := "my-vm"
+			causes, err := admitter.validateTargetNotRunning(field, "default", vmsnapshotv1alpha1.VirtualMachineRestoreTarget{VirtualMachineName: &name})
+			Expect(err).ToNot(HaveOccurred())
+			Expect(causes).To(HaveLen(1))
+		})
+
+		It("allows restoring onto a brand new VM name", func() {
+			name := "does-not-exist-yet"
+			vmInterface.EXPECT().Get(name, gomock.Any()).Return(nil, errors.NewNotFound(schema.GroupResource{}, name))
+
+			causes, err := admitter.validateTargetNotRunning(field, "default", vmsnapshotv1alpha1.VirtualMachineRestoreTarget{NewVMName: &name})
+			Expect(err).ToNot(HaveOccurred())
+			Expect(causes).To(BeEmpty())
+		})
+	})
+})
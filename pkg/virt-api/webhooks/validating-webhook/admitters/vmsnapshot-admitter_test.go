@@ -0,0 +1,61 @@
+/*
+ * This file is part of the KubeVirt project
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ *
+ * Copyright 2018 Red Hat, Inc.
+ *
+ */
+
+package admitters
+
+import (
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+
+	vmsnapshotv1alpha1 "kubevirt.io/client-go/apis/snapshot/v1alpha1"
+)
+
+var _ = Describe("numSourcesSet", func() {
+	It("returns 0 when no source is set", func() {
+		Expect(numSourcesSet(vmsnapshotv1alpha1.VirtualMachineSnapshotSource{})).To(Equal(0))
+	})
+
+	It("returns 1 when only virtualMachineName is set", func() {
+		name := "my-vm"
+		source := vmsnapshotv1alpha1.VirtualMachineSnapshotSource{VirtualMachineName: &name}
+		Expect(numSourcesSet(source)).To(Equal(1))
+	})
+
+	It("returns 1 when only virtualMachineInstanceName is set", func() {
+		name := "my-vmi"
+		source := vmsnapshotv1alpha1.VirtualMachineSnapshotSource{VirtualMachineInstanceName: &name}
+		Expect(numSourcesSet(source)).To(Equal(1))
+	})
+
+	It("returns 1 when only persistentVolumeClaims is set", func() {
+		source := vmsnapshotv1alpha1.VirtualMachineSnapshotSource{PersistentVolumeClaims: []string{"my-pvc"}}
+		Expect(numSourcesSet(source)).To(Equal(1))
+	})
+
+	It("returns more than 1 when multiple sources are set", func() {
+		vmName := "my-vm"
+		vmiName := "my-vmi"
+		source := vmsnapshotv1alpha1.VirtualMachineSnapshotSource{
+			VirtualMachineName:         &vmName,
+			VirtualMachineInstanceName: &vmiName,
+			PersistentVolumeClaims:     []string{"my-pvc"},
+		}
+		Expect(numSourcesSet(source)).To(Equal(3))
+	})
+})
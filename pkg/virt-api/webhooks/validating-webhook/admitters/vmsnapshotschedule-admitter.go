@@ -0,0 +1,188 @@
+/*
+ * This file is part of the KubeVirt project
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ *
+ * Copyright 2018 Red Hat, Inc.
+ *
+ */
+
+package admitters
+
+import (
+	"encoding/json"
+	"fmt"
+
+	"github.com/robfig/cron/v3"
+
+	admissionv1 "k8s.io/api/admission/v1"
+	"k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	k8sfield "k8s.io/apimachinery/pkg/util/validation/field"
+
+	vmsnapshotv1alpha1 "kubevirt.io/client-go/apis/snapshot/v1alpha1"
+	"kubevirt.io/client-go/kubecli"
+	webhookutils "kubevirt.io/kubevirt/pkg/util/webhooks"
+	"kubevirt.io/kubevirt/pkg/virt-controller/snapshot/validation"
+)
+
+// scheduleImmutableFields is the part of VirtualMachineSnapshotScheduleSpec that
+// ValidateSpecImmutable compares on update: Schedule and Source, but not Retention, which is
+// safe to tune after creation.
+type scheduleImmutableFields struct {
+	Schedule string
+	Source   vmsnapshotv1alpha1.VirtualMachineSnapshotScheduleSource
+}
+
+const (
+	// minRetainedSnapshots is the lowest Spec.Retention.MaxSnapshots a schedule may request.
+	minRetainedSnapshots = 1
+	// maxRetainedSnapshots is the highest Spec.Retention.MaxSnapshots a schedule may request.
+	maxRetainedSnapshots = 100
+)
+
+// VMSnapshotScheduleAdmitter validates VirtualMachineSnapshotSchedules
+type VMSnapshotScheduleAdmitter struct {
+	Client kubecli.KubevirtClient
+}
+
+// NewVMSnapshotScheduleAdmitter creates a VMSnapshotScheduleAdmitter
+func NewVMSnapshotScheduleAdmitter(client kubecli.KubevirtClient) *VMSnapshotScheduleAdmitter {
+	return &VMSnapshotScheduleAdmitter{
+		Client: client,
+	}
+}
+
+// Admit validates an AdmissionReview
+func (admitter *VMSnapshotScheduleAdmitter) Admit(ar *admissionv1.AdmissionReview) *admissionv1.AdmissionResponse {
+	if ar.Request.Resource.Group != vmsnapshotv1alpha1.SchemeGroupVersion.Group ||
+		ar.Request.Resource.Resource != "virtualmachinesnapshotschedules" {
+		return webhookutils.ToAdmissionResponseError(fmt.Errorf("Unexpected Resource %+v", ar.Request.Resource))
+	}
+
+	schedule := &vmsnapshotv1alpha1.VirtualMachineSnapshotSchedule{}
+	// TODO ideally use UniversalDeserializer here
+	err := json.Unmarshal(ar.Request.Object.Raw, schedule)
+	if err != nil {
+		return webhookutils.ToAdmissionResponseError(err)
+	}
+
+	var causes []metav1.StatusCause
+
+	switch ar.Request.Operation {
+	case admissionv1.Create:
+		specField := k8sfield.NewPath("spec")
+
+		causes = append(causes, admitter.validateCron(specField.Child("schedule"), schedule.Spec.Schedule)...)
+
+		if ar.Request.DryRun == nil || !*ar.Request.DryRun {
+			// skip the live VM lookup so dry-run apply plans don't fail against a VM
+			// that may not exist yet in the same apply
+			sourceCauses, err := admitter.validateSource(specField.Child("source"), ar.Request.Namespace, schedule.Spec.Source)
+			if err != nil {
+				return webhookutils.ToAdmissionResponseError(err)
+			}
+			causes = append(causes, sourceCauses...)
+		}
+
+		causes = append(causes, admitter.validateRetention(specField.Child("retention"), schedule.Spec.Retention)...)
+	case admissionv1.Update:
+		prevObj := &vmsnapshotv1alpha1.VirtualMachineSnapshotSchedule{}
+		err = json.Unmarshal(ar.Request.OldObject.Raw, prevObj)
+		if err != nil {
+			return webhookutils.ToAdmissionResponseError(err)
+		}
+
+		causes = validation.ValidateSpecImmutable(
+			scheduleImmutableFields{Schedule: prevObj.Spec.Schedule, Source: prevObj.Spec.Source},
+			scheduleImmutableFields{Schedule: schedule.Spec.Schedule, Source: schedule.Spec.Source},
+			"spec.schedule and spec.source are immutable after creation",
+		)
+	default:
+		return webhookutils.ToAdmissionResponseError(fmt.Errorf("unexpected operation %s", ar.Request.Operation))
+	}
+
+	if len(causes) > 0 {
+		return webhookutils.ToAdmissionResponse(causes)
+	}
+
+	reviewResponse := admissionv1.AdmissionResponse{
+		Allowed: true,
+	}
+	return &reviewResponse
+}
+
+func (admitter *VMSnapshotScheduleAdmitter) validateCron(field *k8sfield.Path, expr string) []metav1.StatusCause {
+	if _, err := cron.ParseStandard(expr); err != nil {
+		return []metav1.StatusCause{
+			{
+				Type:    metav1.CauseTypeFieldValueInvalid,
+				Message: fmt.Sprintf("invalid cron schedule %q: %v", expr, err),
+				Field:   field.String(),
+			},
+		}
+	}
+
+	return nil
+}
+
+func (admitter *VMSnapshotScheduleAdmitter) validateSource(field *k8sfield.Path, namespace string, source vmsnapshotv1alpha1.VirtualMachineSnapshotScheduleSource) ([]metav1.StatusCause, error) {
+	if source.VirtualMachineName == nil {
+		return []metav1.StatusCause{
+			{
+				Type:    metav1.CauseTypeFieldValueNotFound,
+				Message: "missing source name",
+				Field:   field.String(),
+			},
+		}, nil
+	}
+
+	_, err := admitter.Client.VirtualMachine(namespace).Get(*source.VirtualMachineName, &metav1.GetOptions{})
+	if errors.IsNotFound(err) {
+		return []metav1.StatusCause{
+			{
+				Type:    metav1.CauseTypeFieldValueInvalid,
+				Message: fmt.Sprintf("VirtualMachine %q does not exist", *source.VirtualMachineName),
+				Field:   field.Child("virtualMachineName").String(),
+			},
+		}, nil
+	}
+
+	if err != nil {
+		return nil, err
+	}
+
+	return nil, nil
+}
+
+func (admitter *VMSnapshotScheduleAdmitter) validateRetention(field *k8sfield.Path, retention vmsnapshotv1alpha1.VirtualMachineSnapshotScheduleRetention) []metav1.StatusCause {
+	var causes []metav1.StatusCause
+
+	if retention.MaxSnapshots != nil && (*retention.MaxSnapshots < minRetainedSnapshots || *retention.MaxSnapshots > maxRetainedSnapshots) {
+		causes = append(causes, metav1.StatusCause{
+			Type:    metav1.CauseTypeFieldValueInvalid,
+			Message: fmt.Sprintf("maxSnapshots must be between %d and %d", minRetainedSnapshots, maxRetainedSnapshots),
+			Field:   field.Child("maxSnapshots").String(),
+		})
+	}
+
+	if retention.MaxAge != nil && retention.MaxAge.Duration <= 0 {
+		causes = append(causes, metav1.StatusCause{
+			Type:    metav1.CauseTypeFieldValueInvalid,
+			Message: "maxAge must be a positive duration",
+			Field:   field.Child("maxAge").String(),
+		})
+	}
+
+	return causes
+}
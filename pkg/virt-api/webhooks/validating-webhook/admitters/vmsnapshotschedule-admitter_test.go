@@ -0,0 +1,73 @@
+/*
+ * This file is part of the KubeVirt project
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ *
+ * Copyright 2018 Red Hat, Inc.
+ *
+ */
+
+package admitters
+
+import (
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	k8sfield "k8s.io/apimachinery/pkg/util/validation/field"
+
+	vmsnapshotv1alpha1 "kubevirt.io/client-go/apis/snapshot/v1alpha1"
+)
+
+var _ = Describe("VMSnapshotScheduleAdmitter", func() {
+	admitter := &VMSnapshotScheduleAdmitter{}
+
+	Context("validateCron", func() {
+		field := k8sfield.NewPath("spec", "schedule")
+
+		It("accepts a valid standard cron expression", func() {
+			Expect(admitter.validateCron(field, "0 0 * * *")).To(BeEmpty())
+		})
+
+		It("rejects an invalid cron expression", func() {
+			Expect(admitter.validateCron(field, "not-a-cron-expression")).To(HaveLen(1))
+		})
+	})
+
+	Context("validateRetention", func() {
+		field := k8sfield.NewPath("spec", "retention")
+
+		It("accepts maxSnapshots within bounds", func() {
+			max := int32(10)
+			retention := vmsnapshotv1alpha1.VirtualMachineSnapshotScheduleRetention{MaxSnapshots: &max}
+			Expect(admitter.validateRetention(field, retention)).To(BeEmpty())
+		})
+
+		It("rejects maxSnapshots below the minimum", func() {
+			max := int32(0)
+			retention := vmsnapshotv1alpha1.VirtualMachineSnapshotScheduleRetention{MaxSnapshots: &max}
+			Expect(admitter.validateRetention(field, retention)).To(HaveLen(1))
+		})
+
+		It("rejects maxSnapshots above the maximum", func() {
+			max := int32(101)
+			retention := vmsnapshotv1alpha1.VirtualMachineSnapshotScheduleRetention{MaxSnapshots: &max}
+			Expect(admitter.validateRetention(field, retention)).To(HaveLen(1))
+		})
+
+		It("rejects a non-positive maxAge", func() {
+			retention := vmsnapshotv1alpha1.VirtualMachineSnapshotScheduleRetention{MaxAge: &metav1.Duration{Duration: 0}}
+			Expect(admitter.validateRetention(field, retention)).To(HaveLen(1))
+		})
+	})
+})
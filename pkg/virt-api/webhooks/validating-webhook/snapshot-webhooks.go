@@ -0,0 +1,69 @@
+/*
+ * This file is part of the KubeVirt project
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ *
+ * Copyright 2018 Red Hat, Inc.
+ *
+ */
+
+package validating_webhook
+
+import (
+	admissionregistrationv1 "k8s.io/api/admissionregistration/v1"
+
+	vmsnapshotv1alpha1 "kubevirt.io/client-go/apis/snapshot/v1alpha1"
+)
+
+// snapshotWebhookResources lists the snapshot-related resources that share the same
+// admission/v1 (with v1beta1 fallback) webhook rules.
+var snapshotWebhookResources = []string{
+	"virtualmachinesnapshots",
+	"virtualmachinerestores",
+	"virtualmachinesnapshotschedules",
+}
+
+// SnapshotValidatingWebhooks returns the ValidatingWebhook entries for the snapshot
+// admitters. All of them run against admission/v1, falling back to v1beta1 for older
+// apiservers, and declare no side effects on dry-run so the apiserver sends dry-run
+// requests to them instead of rejecting those requests outright. The admitters still
+// reject dry-run requests that fail their checks.
+func SnapshotValidatingWebhooks() []admissionregistrationv1.ValidatingWebhook {
+	sideEffectsNone := admissionregistrationv1.SideEffectClassNoneOnDryRun
+	failurePolicy := admissionregistrationv1.Fail
+
+	webhooks := make([]admissionregistrationv1.ValidatingWebhook, 0, len(snapshotWebhookResources))
+	for _, resource := range snapshotWebhookResources {
+		webhooks = append(webhooks, admissionregistrationv1.ValidatingWebhook{
+			Name: resource + "-validator.snapshot." + vmsnapshotv1alpha1.SchemeGroupVersion.Group,
+			Rules: []admissionregistrationv1.RuleWithOperations{
+				{
+					Operations: []admissionregistrationv1.OperationType{
+						admissionregistrationv1.Create,
+						admissionregistrationv1.Update,
+					},
+					Rule: admissionregistrationv1.Rule{
+						APIGroups:   []string{vmsnapshotv1alpha1.SchemeGroupVersion.Group},
+						APIVersions: []string{vmsnapshotv1alpha1.SchemeGroupVersion.Version},
+						Resources:   []string{resource},
+					},
+				},
+			},
+			FailurePolicy:           &failurePolicy,
+			SideEffects:             &sideEffectsNone,
+			AdmissionReviewVersions: []string{"v1", "v1beta1"},
+		})
+	}
+
+	return webhooks
+}
@@ -0,0 +1,197 @@
+/*
+ * This file is part of the KubeVirt project
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ *
+ * Copyright 2018 Red Hat, Inc.
+ *
+ */
+
+// Package validation holds the VirtualMachineSnapshot validation rules shared between the
+// admission webhook, which enforces them synchronously at create/update time, and the
+// lint-snapshots tooling, which re-applies them after the fact to catch objects that have
+// since drifted (e.g. their source VM was deleted).
+package validation
+
+import (
+	"context"
+	"fmt"
+	"reflect"
+
+	"k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	k8sfield "k8s.io/apimachinery/pkg/util/validation/field"
+
+	vmsnapshotv1alpha1 "kubevirt.io/client-go/apis/snapshot/v1alpha1"
+	"kubevirt.io/client-go/kubecli"
+)
+
+// ValidateSourceVM checks that the VirtualMachine referenced by a VirtualMachineSnapshot
+// exists, and that it is not running unless policy allows an online snapshot of a running
+// VM (vmsnapshotv1alpha1.OnlineSnapshotAllowCrashConsistent or
+// vmsnapshotv1alpha1.OnlineSnapshotAllowQuiesced).
+func ValidateSourceVM(client kubecli.KubevirtClient, field *k8sfield.Path, namespace, name string, policy vmsnapshotv1alpha1.OnlineSnapshotPolicy) ([]metav1.StatusCause, error) {
+	vm, err := client.VirtualMachine(namespace).Get(name, &metav1.GetOptions{})
+	if errors.IsNotFound(err) {
+		return []metav1.StatusCause{
+			{
+				Type:    metav1.CauseTypeFieldValueInvalid,
+				Message: fmt.Sprintf("VirtualMachine %q does not exist", name),
+				Field:   field.String(),
+			},
+		}, nil
+	}
+
+	if err != nil {
+		return nil, err
+	}
+
+	var causes []metav1.StatusCause
+
+	running := vm.Spec.Running != nil && *vm.Spec.Running
+	allowsOnline := policy == vmsnapshotv1alpha1.OnlineSnapshotAllowCrashConsistent || policy == vmsnapshotv1alpha1.OnlineSnapshotAllowQuiesced
+
+	if running && !allowsOnline {
+		causes = append(causes, metav1.StatusCause{
+			Type:    metav1.CauseTypeFieldValueInvalid,
+			Message: fmt.Sprintf("VirtualMachine %q is running", name),
+			Field:   field.String(),
+		})
+	}
+
+	return causes, nil
+}
+
+// ValidateSourceVMExists checks only that the VirtualMachine referenced by a
+// VirtualMachineSnapshot still exists, without regard to whether it is running. Unlike
+// ValidateSourceVM, this is safe to use after the snapshot has already been taken: a
+// completed snapshot's source VM being started again later is normal lifecycle, not a
+// hygiene problem.
+func ValidateSourceVMExists(client kubecli.KubevirtClient, field *k8sfield.Path, namespace, name string) ([]metav1.StatusCause, error) {
+	_, err := client.VirtualMachine(namespace).Get(name, &metav1.GetOptions{})
+	if errors.IsNotFound(err) {
+		return []metav1.StatusCause{
+			{
+				Type:    metav1.CauseTypeFieldValueInvalid,
+				Message: fmt.Sprintf("VirtualMachine %q does not exist", name),
+				Field:   field.String(),
+			},
+		}, nil
+	}
+
+	if err != nil {
+		return nil, err
+	}
+
+	return nil, nil
+}
+
+// ValidateSourceVMIExists checks only that the VirtualMachineInstance referenced by a
+// VirtualMachineSnapshot still exists, for use by lint-snapshots when auditing a
+// VMI-sourced snapshot for an orphaned source.
+func ValidateSourceVMIExists(client kubecli.KubevirtClient, field *k8sfield.Path, namespace, name string) ([]metav1.StatusCause, error) {
+	_, err := client.VirtualMachineInstance(namespace).Get(name, &metav1.GetOptions{})
+	if errors.IsNotFound(err) {
+		return []metav1.StatusCause{
+			{
+				Type:    metav1.CauseTypeFieldValueInvalid,
+				Message: fmt.Sprintf("VirtualMachineInstance %q does not exist", name),
+				Field:   field.String(),
+			},
+		}, nil
+	}
+
+	if err != nil {
+		return nil, err
+	}
+
+	return nil, nil
+}
+
+// ValidateSourcePVCExists checks only that the PersistentVolumeClaim referenced by a
+// VirtualMachineSnapshot still exists, for use by lint-snapshots when auditing a
+// PVC-sourced snapshot for an orphaned source.
+func ValidateSourcePVCExists(client kubecli.KubevirtClient, field *k8sfield.Path, namespace, name string) ([]metav1.StatusCause, error) {
+	_, err := client.CoreV1().PersistentVolumeClaims(namespace).Get(context.Background(), name, metav1.GetOptions{})
+	if errors.IsNotFound(err) {
+		return []metav1.StatusCause{
+			{
+				Type:    metav1.CauseTypeFieldValueInvalid,
+				Message: fmt.Sprintf("PersistentVolumeClaim %q does not exist", name),
+				Field:   field.String(),
+			},
+		}, nil
+	}
+
+	if err != nil {
+		return nil, err
+	}
+
+	return nil, nil
+}
+
+// ValidateSourceSnapshotExists checks that the VirtualMachineSnapshot referenced by a
+// VirtualMachineRestore still exists.
+func ValidateSourceSnapshotExists(client kubecli.KubevirtClient, field *k8sfield.Path, namespace, name string) ([]metav1.StatusCause, error) {
+	_, err := client.VirtualMachineSnapshot(namespace).Get(name, &metav1.GetOptions{})
+	if errors.IsNotFound(err) {
+		return []metav1.StatusCause{
+			{
+				Type:    metav1.CauseTypeFieldValueInvalid,
+				Message: fmt.Sprintf("VirtualMachineSnapshot %q does not exist", name),
+				Field:   field.String(),
+			},
+		}, nil
+	}
+
+	if err != nil {
+		return nil, err
+	}
+
+	return nil, nil
+}
+
+// ValidateSpecImmutable compares prev and cur, the old and new value of all or part of a
+// snapshot-related Spec, and returns a cause with message if they differ. It is shared by
+// the VirtualMachineSnapshot, VirtualMachineRestore and VirtualMachineSnapshotSchedule
+// admitters so each doesn't reimplement its own reflect.DeepEqual immutability check.
+func ValidateSpecImmutable(prev, cur interface{}, message string) []metav1.StatusCause {
+	if reflect.DeepEqual(prev, cur) {
+		return nil
+	}
+
+	return []metav1.StatusCause{
+		{
+			Type:    metav1.CauseTypeFieldValueInvalid,
+			Message: message,
+			Field:   k8sfield.NewPath("spec").String(),
+		},
+	}
+}
+
+// ValidateVolumeSnapshotContentExists reports a cause when exists is false, i.e. a
+// VirtualMachineSnapshot is pointing at a VolumeSnapshotContent that no longer exists, which leaves
+// the snapshot unusable for restores even though its own object is still present.
+func ValidateVolumeSnapshotContentExists(exists bool, field *k8sfield.Path, name string) []metav1.StatusCause {
+	if exists {
+		return nil
+	}
+
+	return []metav1.StatusCause{
+		{
+			Type:    metav1.CauseTypeFieldValueInvalid,
+			Message: fmt.Sprintf("VolumeSnapshotContent %q no longer exists", name),
+			Field:   field.String(),
+		},
+	}
+}
@@ -0,0 +1,110 @@
+/*
+ * This file is part of the KubeVirt project
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ *
+ * Copyright 2018 Red Hat, Inc.
+ *
+ */
+
+package validation
+
+import (
+	"testing"
+
+	"github.com/golang/mock/gomock"
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+
+	k8sfield "k8s.io/apimachinery/pkg/util/validation/field"
+
+	kubevirtv1 "kubevirt.io/client-go/api/v1"
+	vmsnapshotv1alpha1 "kubevirt.io/client-go/apis/snapshot/v1alpha1"
+	"kubevirt.io/client-go/kubecli"
+)
+
+func TestValidation(t *testing.T) {
+	RegisterFailHandler(Fail)
+	RunSpecs(t, "Snapshot validation Suite")
+}
+
+var _ = Describe("ValidateSourceVM", func() {
+	var (
+		ctrl        *gomock.Controller
+		client      *kubecli.MockKubevirtClient
+		vmInterface *kubecli.MockVirtualMachineInterface
+		field       = k8sfield.NewPath("spec", "source", "virtualMachineName")
+		runningVM   *kubevirtv1.VirtualMachine
+		stoppedVM   *kubevirtv1.VirtualMachine
+	)
+
+	BeforeEach(func() {
+		ctrl = gomock.NewController(GinkgoT())
+		client = kubecli.NewMockKubevirtClient(ctrl)
+		vmInterface = kubecli.NewMockVirtualMachineInterface(ctrl)
+		client.EXPECT().VirtualMachine(gomock.Any()).Return(vmInterface).AnyTimes()
+
+		running := true
+		stopped := false
+		runningVM = &kubevirtv1.VirtualMachine{Spec: kubevirtv1.VirtualMachineSpec{Running: &running}}
+		stoppedVM = &kubevirtv1.VirtualMachine{Spec: kubevirtv1.VirtualMachineSpec{Running: &stopped}}
+	})
+
+	AfterEach(func() {
+		ctrl.Finish()
+	})
+
+	It("rejects a running VM when OnlineSnapshot is Deny", func() {
+		vmInterface.EXPECT().Get("test-vm", gomock.Any()).Return(runningVM, nil)
+
+		causes, err := ValidateSourceVM(client, field, "default", "test-vm", vmsnapshotv1alpha1.OnlineSnapshotDeny)
+		Expect(err).ToNot(HaveOccurred())
+		Expect(causes).To(HaveLen(1))
+	})
+
+	It("allows a running VM when OnlineSnapshot is AllowCrashConsistent", func() {
+		vmInterface.EXPECT().Get("test-vm", gomock.Any()).Return(runningVM, nil)
+
+		causes, err := ValidateSourceVM(client, field, "default", "test-vm", vmsnapshotv1alpha1.OnlineSnapshotAllowCrashConsistent)
+		Expect(err).ToNot(HaveOccurred())
+		Expect(causes).To(BeEmpty())
+	})
+
+	It("allows a running VM when OnlineSnapshot is AllowQuiesced", func() {
+		vmInterface.EXPECT().Get("test-vm", gomock.Any()).Return(runningVM, nil)
+
+		causes, err := ValidateSourceVM(client, field, "default", "test-vm", vmsnapshotv1alpha1.OnlineSnapshotAllowQuiesced)
+		Expect(err).ToNot(HaveOccurred())
+		Expect(causes).To(BeEmpty())
+	})
+
+	It("allows a stopped VM regardless of policy", func() {
+		vmInterface.EXPECT().Get("test-vm", gomock.Any()).Return(stoppedVM, nil)
+
+		causes, err := ValidateSourceVM(client, field, "default", "test-vm", vmsnapshotv1alpha1.OnlineSnapshotDeny)
+		Expect(err).ToNot(HaveOccurred())
+		Expect(causes).To(BeEmpty())
+	})
+})
+
+var _ = Describe("ValidateVolumeSnapshotContentExists", func() {
+	It("reports a cause when the content is gone", func() {
+		causes := ValidateVolumeSnapshotContentExists(false, k8sfield.NewPath("status"), "snapcontent-123")
+		Expect(causes).To(HaveLen(1))
+	})
+
+	It("reports nothing when the content still exists", func() {
+		causes := ValidateVolumeSnapshotContentExists(true, k8sfield.NewPath("status"), "snapcontent-123")
+		Expect(causes).To(BeEmpty())
+	})
+})
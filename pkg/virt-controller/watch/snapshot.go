@@ -0,0 +1,305 @@
+/*
+ * This file is part of the KubeVirt project
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ *
+ * Copyright 2018 Red Hat, Inc.
+ *
+ */
+
+package watch
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	snapshotv1 "github.com/kubernetes-csi/external-snapshotter/client/v4/apis/volumesnapshot/v1"
+	snapshotclient "github.com/kubernetes-csi/external-snapshotter/client/v4/clientset/versioned"
+
+	"k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/util/wait"
+	"k8s.io/client-go/tools/cache"
+	"k8s.io/client-go/util/workqueue"
+
+	vmsnapshotv1alpha1 "kubevirt.io/client-go/apis/snapshot/v1alpha1"
+	"kubevirt.io/client-go/kubecli"
+	"kubevirt.io/client-go/log"
+)
+
+// unfreezeTimeout bounds how long the guest is allowed to stay frozen before the agent
+// gives up and thaws it on its own, in case virt-controller never gets to call thaw.
+const unfreezeTimeout = 5 * time.Minute
+
+// VMSnapshotController creates and tracks VirtualMachineSnapshots, quiescing the guest
+// filesystem around the underlying VolumeSnapshot calls when the source VMSnapshot
+// requests Spec.OnlineSnapshot == AllowQuiesced.
+type VMSnapshotController struct {
+	clientset      kubecli.KubevirtClient
+	snapshotClient snapshotclient.Interface
+	queue          workqueue.RateLimitingInterface
+}
+
+// NewVMSnapshotController creates a new VMSnapshotController
+func NewVMSnapshotController(clientset kubecli.KubevirtClient, snapshotClient snapshotclient.Interface) *VMSnapshotController {
+	return &VMSnapshotController{
+		clientset:      clientset,
+		snapshotClient: snapshotClient,
+		queue:          workqueue.NewNamedRateLimitingQueue(workqueue.DefaultControllerRateLimiter(), "virt-controller-vm-snapshot"),
+	}
+}
+
+// Enqueue adds a VirtualMachineSnapshot's key to the work queue.
+func (c *VMSnapshotController) Enqueue(obj interface{}) {
+	key, err := cache.MetaNamespaceKeyFunc(obj)
+	if err != nil {
+		log.Log.Reason(err).Error("failed to extract key from VirtualMachineSnapshot")
+		return
+	}
+	c.queue.Add(key)
+}
+
+// Run starts threadiness workers processing the queue until stopCh is closed.
+func (c *VMSnapshotController) Run(threadiness int, stopCh <-chan struct{}) {
+	defer c.queue.ShutDown()
+
+	log.Log.Info("Starting VirtualMachineSnapshot controller")
+	defer log.Log.Info("Shutting down VirtualMachineSnapshot controller")
+
+	for i := 0; i < threadiness; i++ {
+		go wait.Until(c.runWorker, time.Second, stopCh)
+	}
+
+	<-stopCh
+}
+
+func (c *VMSnapshotController) runWorker() {
+	for c.processNextWorkItem() {
+	}
+}
+
+func (c *VMSnapshotController) processNextWorkItem() bool {
+	key, shutdown := c.queue.Get()
+	if shutdown {
+		return false
+	}
+	defer c.queue.Done(key)
+
+	if err := c.execute(key.(string)); err != nil {
+		log.Log.Reason(err).Errorf("failed to sync VirtualMachineSnapshot %v, will retry", key)
+		c.queue.AddRateLimited(key)
+	} else {
+		c.queue.Forget(key)
+	}
+
+	return true
+}
+
+func (c *VMSnapshotController) execute(key string) error {
+	namespace, name, err := cache.SplitMetaNamespaceKey(key)
+	if err != nil {
+		return err
+	}
+
+	vmSnapshot, err := c.clientset.VirtualMachineSnapshot(namespace).Get(name, &metav1.GetOptions{})
+	if errors.IsNotFound(err) {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+
+	if vmSnapshot.Status != nil && vmSnapshot.Status.Phase == vmsnapshotv1alpha1.Ready {
+		return nil
+	}
+
+	var pvcNames []string
+	vmiName := vmiNameForSource(vmSnapshot.Spec.Source)
+	if vmiName == "" {
+		// disk-only (PVC) sources have no VMI to quiesce
+		pvcNames = vmSnapshot.Spec.Source.PersistentVolumeClaims
+	} else {
+		pvcNames, err = c.pvcNamesForVMI(namespace, vmiName)
+		if err != nil {
+			return err
+		}
+	}
+
+	if err := c.markInProgress(vmSnapshot); err != nil {
+		return err
+	}
+
+	if vmiName == "" {
+		err = c.createVolumeSnapshots(vmSnapshot, namespace, pvcNames)
+	} else {
+		err = c.takeSnapshot(vmSnapshot, namespace, vmiName, pvcNames)
+	}
+	if err != nil {
+		return err
+	}
+
+	bound, err := c.volumeSnapshotsBound(namespace, vmSnapshot.Name, pvcNames)
+	if err != nil {
+		return err
+	}
+	if !bound {
+		return fmt.Errorf("VolumeSnapshots for VirtualMachineSnapshot %s/%s are not bound yet", namespace, name)
+	}
+
+	return c.markReady(vmSnapshot)
+}
+
+// markInProgress records that vmSnapshot's VolumeSnapshots are being created, so a restore
+// admitted against it can be rejected until they are ready.
+func (c *VMSnapshotController) markInProgress(vmSnapshot *vmsnapshotv1alpha1.VirtualMachineSnapshot) error {
+	if vmSnapshot.Status != nil && vmSnapshot.Status.Phase == vmsnapshotv1alpha1.InProgress {
+		return nil
+	}
+
+	updated := vmSnapshot.DeepCopy()
+	if updated.Status == nil {
+		updated.Status = &vmsnapshotv1alpha1.VirtualMachineSnapshotStatus{}
+	}
+	updated.Status.Phase = vmsnapshotv1alpha1.InProgress
+
+	_, err := c.clientset.VirtualMachineSnapshot(vmSnapshot.Namespace).UpdateStatus(updated)
+	return err
+}
+
+// markReady records that every VolumeSnapshot backing vmSnapshot is bound, which is the
+// signal vmrestore-admitter.go requires before allowing a VirtualMachineRestore against it.
+func (c *VMSnapshotController) markReady(vmSnapshot *vmsnapshotv1alpha1.VirtualMachineSnapshot) error {
+	updated := vmSnapshot.DeepCopy()
+	if updated.Status == nil {
+		updated.Status = &vmsnapshotv1alpha1.VirtualMachineSnapshotStatus{}
+	}
+	updated.Status.Phase = vmsnapshotv1alpha1.Ready
+
+	_, err := c.clientset.VirtualMachineSnapshot(vmSnapshot.Namespace).UpdateStatus(updated)
+	return err
+}
+
+// volumeSnapshotsBound reports whether every VolumeSnapshot created for pvcNames by
+// createVolumeSnapshots has been bound to a VolumeSnapshotContent by the CSI driver.
+func (c *VMSnapshotController) volumeSnapshotsBound(namespace, vmSnapshotName string, pvcNames []string) (bool, error) {
+	for _, pvcName := range pvcNames {
+		volumeSnapshot, err := c.snapshotClient.SnapshotV1().VolumeSnapshots(namespace).Get(context.Background(), fmt.Sprintf("%s-%s", vmSnapshotName, pvcName), metav1.GetOptions{})
+		if err != nil {
+			return false, fmt.Errorf("failed to get VolumeSnapshot for PVC %q: %v", pvcName, err)
+		}
+
+		if volumeSnapshot.Status == nil || volumeSnapshot.Status.BoundVolumeSnapshotContentName == nil {
+			return false, nil
+		}
+	}
+
+	return true, nil
+}
+
+// vmiNameForSource returns the VMI backing a VM/VMI-sourced snapshot, or "" for a
+// disk-only source.
+func vmiNameForSource(source vmsnapshotv1alpha1.VirtualMachineSnapshotSource) string {
+	switch {
+	case source.VirtualMachineName != nil:
+		return *source.VirtualMachineName
+	case source.VirtualMachineInstanceName != nil:
+		return *source.VirtualMachineInstanceName
+	default:
+		return ""
+	}
+}
+
+// takeSnapshot creates the VolumeSnapshots. When Spec.OnlineSnapshot is AllowQuiesced it
+// first quiesces the guest filesystem via the qemu-guest-agent RPC, and thaws it again once
+// they have been created (or on failure); otherwise the guest is not frozen.
+func (c *VMSnapshotController) takeSnapshot(vmSnapshot *vmsnapshotv1alpha1.VirtualMachineSnapshot, namespace, vmiName string, pvcNames []string) error {
+	if vmSnapshot.Spec.OnlineSnapshot != vmsnapshotv1alpha1.OnlineSnapshotAllowQuiesced {
+		return c.createVolumeSnapshots(vmSnapshot, namespace, pvcNames)
+	}
+
+	if _, err := c.clientset.VirtualMachineInstance(namespace).GuestOSInfo(vmiName); err != nil {
+		log.Log.Object(vmSnapshot).Reason(err).Error("failed to reach qemu-guest-agent before freezing filesystems")
+		return err
+	}
+
+	if err := c.freezeGuestFilesystems(namespace, vmiName); err != nil {
+		return fmt.Errorf("guest-fsfreeze-freeze failed for %s/%s: %v", namespace, vmiName, err)
+	}
+
+	snapshotErr := c.createVolumeSnapshots(vmSnapshot, namespace, pvcNames)
+
+	if err := c.thawGuestFilesystems(namespace, vmiName); err != nil {
+		log.Log.Object(vmSnapshot).Reason(err).Errorf("guest-fsfreeze-thaw failed for %s/%s", namespace, vmiName)
+	}
+
+	return snapshotErr
+}
+
+// freezeGuestFilesystems invokes guest-fsfreeze-freeze over the existing qemu-guest-agent
+// RPC so the CSI VolumeSnapshot calls below observe a crash-consistent, quiesced guest.
+func (c *VMSnapshotController) freezeGuestFilesystems(namespace, vmiName string) error {
+	return c.clientset.VirtualMachineInstance(namespace).Freeze(vmiName, unfreezeTimeout)
+}
+
+// thawGuestFilesystems invokes guest-fsfreeze-thaw, always run after the freeze above
+// regardless of whether the VolumeSnapshots succeeded.
+func (c *VMSnapshotController) thawGuestFilesystems(namespace, vmiName string) error {
+	return c.clientset.VirtualMachineInstance(namespace).Unfreeze(vmiName)
+}
+
+// pvcNamesForVMI returns the PVC-backed volumes of the running VMI, which are what
+// actually get a CSI VolumeSnapshot taken of them.
+func (c *VMSnapshotController) pvcNamesForVMI(namespace, vmiName string) ([]string, error) {
+	vmi, err := c.clientset.VirtualMachineInstance(namespace).Get(vmiName, &metav1.GetOptions{})
+	if err != nil {
+		return nil, err
+	}
+
+	var pvcNames []string
+	for _, volume := range vmi.Spec.Volumes {
+		if volume.PersistentVolumeClaim != nil {
+			pvcNames = append(pvcNames, volume.PersistentVolumeClaim.ClaimName)
+		}
+	}
+
+	return pvcNames, nil
+}
+
+// createVolumeSnapshots creates a CSI VolumeSnapshot for each of the given PVCs, owned by
+// vmSnapshot so they get garbage-collected together with it.
+func (c *VMSnapshotController) createVolumeSnapshots(vmSnapshot *vmsnapshotv1alpha1.VirtualMachineSnapshot, namespace string, pvcNames []string) error {
+	for _, pvcName := range pvcNames {
+		volumeSnapshot := &snapshotv1.VolumeSnapshot{
+			ObjectMeta: metav1.ObjectMeta{
+				Name:      fmt.Sprintf("%s-%s", vmSnapshot.Name, pvcName),
+				Namespace: namespace,
+				OwnerReferences: []metav1.OwnerReference{
+					*metav1.NewControllerRef(vmSnapshot, vmsnapshotv1alpha1.SchemeGroupVersion.WithKind("VirtualMachineSnapshot")),
+				},
+			},
+			Spec: snapshotv1.VolumeSnapshotSpec{
+				Source: snapshotv1.VolumeSnapshotSource{
+					PersistentVolumeClaimName: &pvcName,
+				},
+			},
+		}
+
+		_, err := c.snapshotClient.SnapshotV1().VolumeSnapshots(namespace).Create(context.Background(), volumeSnapshot, metav1.CreateOptions{})
+		if err != nil && !errors.IsAlreadyExists(err) {
+			return fmt.Errorf("failed to create VolumeSnapshot for PVC %q: %v", pvcName, err)
+		}
+	}
+
+	return nil
+}
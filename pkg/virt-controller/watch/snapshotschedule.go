@@ -0,0 +1,258 @@
+/*
+ * This file is part of the KubeVirt project
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ *
+ * Copyright 2018 Red Hat, Inc.
+ *
+ */
+
+package watch
+
+import (
+	"fmt"
+	"sort"
+	"time"
+
+	"github.com/robfig/cron/v3"
+
+	"k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/util/wait"
+	"k8s.io/client-go/tools/cache"
+	"k8s.io/client-go/util/workqueue"
+
+	vmsnapshotv1alpha1 "kubevirt.io/client-go/apis/snapshot/v1alpha1"
+	"kubevirt.io/client-go/kubecli"
+	"kubevirt.io/client-go/log"
+)
+
+// resyncPeriod is how often the controller re-lists VirtualMachineSnapshotSchedules to
+// check whether any of them are due to fire. There is no schedule-backed informer in this
+// package, so the work queue is primed on a timer rather than from watch events.
+const resyncPeriod = time.Minute
+
+// VMSnapshotScheduleController creates VirtualMachineSnapshots on the configured cron
+// schedule and garbage-collects old ones once a schedule's retention policy is exceeded.
+type VMSnapshotScheduleController struct {
+	clientset kubecli.KubevirtClient
+	queue     workqueue.RateLimitingInterface
+}
+
+// NewVMSnapshotScheduleController creates a new VMSnapshotScheduleController
+func NewVMSnapshotScheduleController(clientset kubecli.KubevirtClient) *VMSnapshotScheduleController {
+	return &VMSnapshotScheduleController{
+		clientset: clientset,
+		queue:     workqueue.NewNamedRateLimitingQueue(workqueue.DefaultControllerRateLimiter(), "virt-controller-vm-snapshot-schedule"),
+	}
+}
+
+// Enqueue adds a VirtualMachineSnapshotSchedule's key to the work queue.
+func (c *VMSnapshotScheduleController) Enqueue(obj interface{}) {
+	key, err := cache.MetaNamespaceKeyFunc(obj)
+	if err != nil {
+		log.Log.Reason(err).Error("failed to extract key from VirtualMachineSnapshotSchedule")
+		return
+	}
+	c.queue.Add(key)
+}
+
+// Run starts threadiness workers processing the queue, primed every resyncPeriod, until
+// stopCh is closed.
+func (c *VMSnapshotScheduleController) Run(threadiness int, stopCh <-chan struct{}) {
+	defer c.queue.ShutDown()
+
+	log.Log.Info("Starting VirtualMachineSnapshotSchedule controller")
+	defer log.Log.Info("Shutting down VirtualMachineSnapshotSchedule controller")
+
+	for i := 0; i < threadiness; i++ {
+		go wait.Until(c.runWorker, time.Second, stopCh)
+	}
+
+	go wait.Until(c.enqueueAll, resyncPeriod, stopCh)
+
+	<-stopCh
+}
+
+// enqueueAll lists every VirtualMachineSnapshotSchedule across all namespaces and enqueues
+// it, so each gets a chance to fire or prune on this tick.
+func (c *VMSnapshotScheduleController) enqueueAll() {
+	schedules, err := c.clientset.VirtualMachineSnapshotSchedule(metav1.NamespaceAll).List(&metav1.ListOptions{})
+	if err != nil {
+		log.Log.Reason(err).Error("failed to list VirtualMachineSnapshotSchedules")
+		return
+	}
+
+	for i := range schedules.Items {
+		c.Enqueue(&schedules.Items[i])
+	}
+}
+
+func (c *VMSnapshotScheduleController) runWorker() {
+	for c.processNextWorkItem() {
+	}
+}
+
+func (c *VMSnapshotScheduleController) processNextWorkItem() bool {
+	key, shutdown := c.queue.Get()
+	if shutdown {
+		return false
+	}
+	defer c.queue.Done(key)
+
+	if err := c.execute(key.(string)); err != nil {
+		log.Log.Reason(err).Errorf("failed to sync VirtualMachineSnapshotSchedule %v, will retry", key)
+		c.queue.AddRateLimited(key)
+	} else {
+		c.queue.Forget(key)
+	}
+
+	return true
+}
+
+func (c *VMSnapshotScheduleController) execute(key string) error {
+	namespace, name, err := cache.SplitMetaNamespaceKey(key)
+	if err != nil {
+		return err
+	}
+
+	schedule, err := c.clientset.VirtualMachineSnapshotSchedule(namespace).Get(name, &metav1.GetOptions{})
+	if errors.IsNotFound(err) {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+
+	now := time.Now()
+
+	if err := c.fireIfDue(schedule, now); err != nil {
+		return err
+	}
+
+	return c.prune(schedule, now)
+}
+
+// lastScheduleTime returns the last time the schedule fired, or its creation time if it
+// has never fired yet.
+func lastScheduleTime(schedule *vmsnapshotv1alpha1.VirtualMachineSnapshotSchedule) time.Time {
+	if schedule.Status != nil && schedule.Status.LastScheduleTime != nil {
+		return schedule.Status.LastScheduleTime.Time
+	}
+	return schedule.CreationTimestamp.Time
+}
+
+// fireIfDue creates a new VirtualMachineSnapshot of schedule's source VM if the cron
+// schedule has a fire time since it last ran, and records the new LastScheduleTime.
+func (c *VMSnapshotScheduleController) fireIfDue(schedule *vmsnapshotv1alpha1.VirtualMachineSnapshotSchedule, now time.Time) error {
+	due, err := c.shouldFire(schedule, lastScheduleTime(schedule), now)
+	if err != nil {
+		return err
+	}
+	if !due {
+		return nil
+	}
+
+	snapshot := &vmsnapshotv1alpha1.VirtualMachineSnapshot{
+		ObjectMeta: metav1.ObjectMeta{
+			GenerateName: schedule.Name + "-",
+			Namespace:    schedule.Namespace,
+			OwnerReferences: []metav1.OwnerReference{
+				*metav1.NewControllerRef(schedule, vmsnapshotv1alpha1.SchemeGroupVersion.WithKind("VirtualMachineSnapshotSchedule")),
+			},
+		},
+		Spec: vmsnapshotv1alpha1.VirtualMachineSnapshotSpec{
+			Source: vmsnapshotv1alpha1.VirtualMachineSnapshotSource{
+				VirtualMachineName: schedule.Spec.Source.VirtualMachineName,
+			},
+		},
+	}
+
+	if _, err := c.clientset.VirtualMachineSnapshot(schedule.Namespace).Create(snapshot); err != nil {
+		return fmt.Errorf("failed to create scheduled VirtualMachineSnapshot for %s/%s: %v", schedule.Namespace, schedule.Name, err)
+	}
+
+	updated := schedule.DeepCopy()
+	if updated.Status == nil {
+		updated.Status = &vmsnapshotv1alpha1.VirtualMachineSnapshotScheduleStatus{}
+	}
+	updated.Status.LastScheduleTime = &metav1.Time{Time: now}
+
+	_, err = c.clientset.VirtualMachineSnapshotSchedule(schedule.Namespace).UpdateStatus(updated)
+	return err
+}
+
+// prune enforces schedule's retention policy, deleting the VirtualMachineSnapshots it owns
+// that are no longer within the retained window.
+func (c *VMSnapshotScheduleController) prune(schedule *vmsnapshotv1alpha1.VirtualMachineSnapshotSchedule, now time.Time) error {
+	all, err := c.clientset.VirtualMachineSnapshot(schedule.Namespace).List(&metav1.ListOptions{})
+	if err != nil {
+		return fmt.Errorf("failed to list VirtualMachineSnapshots for %s/%s: %v", schedule.Namespace, schedule.Name, err)
+	}
+
+	var owned []vmsnapshotv1alpha1.VirtualMachineSnapshot
+	for _, snapshot := range all.Items {
+		if metav1.IsControlledBy(&snapshot, schedule) {
+			owned = append(owned, snapshot)
+		}
+	}
+
+	for _, snapshot := range c.pruneSnapshots(schedule, owned, now) {
+		if err := c.clientset.VirtualMachineSnapshot(schedule.Namespace).Delete(snapshot.Name, &metav1.DeleteOptions{}); err != nil && !errors.IsNotFound(err) {
+			return fmt.Errorf("failed to delete VirtualMachineSnapshot %s/%s: %v", snapshot.Namespace, snapshot.Name, err)
+		}
+	}
+
+	return nil
+}
+
+// shouldFire reports whether the schedule's cron expression has a fire time between
+// lastRun (exclusive) and now (inclusive).
+func (c *VMSnapshotScheduleController) shouldFire(schedule *vmsnapshotv1alpha1.VirtualMachineSnapshotSchedule, lastRun, now time.Time) (bool, error) {
+	sched, err := cron.ParseStandard(schedule.Spec.Schedule)
+	if err != nil {
+		return false, err
+	}
+
+	return !sched.Next(lastRun).After(now), nil
+}
+
+// pruneSnapshots enforces Spec.Retention by selecting the oldest snapshots beyond
+// MaxSnapshots and any older than MaxAge for deletion.
+func (c *VMSnapshotScheduleController) pruneSnapshots(schedule *vmsnapshotv1alpha1.VirtualMachineSnapshotSchedule, snapshots []vmsnapshotv1alpha1.VirtualMachineSnapshot, now time.Time) []vmsnapshotv1alpha1.VirtualMachineSnapshot {
+	sort.Slice(snapshots, func(i, j int) bool {
+		return snapshots[i].CreationTimestamp.Before(&snapshots[j].CreationTimestamp)
+	})
+
+	retention := schedule.Spec.Retention
+
+	var toDelete []vmsnapshotv1alpha1.VirtualMachineSnapshot
+
+	if retention.MaxAge != nil {
+		var kept []vmsnapshotv1alpha1.VirtualMachineSnapshot
+		for _, snapshot := range snapshots {
+			if now.Sub(snapshot.CreationTimestamp.Time) > retention.MaxAge.Duration {
+				toDelete = append(toDelete, snapshot)
+			} else {
+				kept = append(kept, snapshot)
+			}
+		}
+		snapshots = kept
+	}
+
+	if retention.MaxSnapshots != nil && len(snapshots) > int(*retention.MaxSnapshots) {
+		toDelete = append(toDelete, snapshots[:len(snapshots)-int(*retention.MaxSnapshots)]...)
+	}
+
+	return toDelete
+}
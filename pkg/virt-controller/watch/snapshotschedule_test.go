@@ -0,0 +1,133 @@
+/*
+ * This file is part of the KubeVirt project
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ *
+ * Copyright 2018 Red Hat, Inc.
+ *
+ */
+
+package watch
+
+import (
+	"testing"
+	"time"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+
+	vmsnapshotv1alpha1 "kubevirt.io/client-go/apis/snapshot/v1alpha1"
+)
+
+func TestWatch(t *testing.T) {
+	RegisterFailHandler(Fail)
+	RunSpecs(t, "Snapshot controllers Suite")
+}
+
+var _ = Describe("VMSnapshotScheduleController", func() {
+	c := &VMSnapshotScheduleController{}
+
+	Context("shouldFire", func() {
+		schedule := &vmsnapshotv1alpha1.VirtualMachineSnapshotSchedule{
+			Spec: vmsnapshotv1alpha1.VirtualMachineSnapshotScheduleSpec{Schedule: "0 * * * *"},
+		}
+
+		It("fires once a fire time has passed since the last run", func() {
+			lastRun := time.Date(2021, 1, 1, 0, 0, 0, 0, time.UTC)
+			now := time.Date(2021, 1, 1, 1, 0, 0, 0, time.UTC)
+
+			due, err := c.shouldFire(schedule, lastRun, now)
+			Expect(err).ToNot(HaveOccurred())
+			Expect(due).To(BeTrue())
+		})
+
+		It("does not fire before the next scheduled time", func() {
+			lastRun := time.Date(2021, 1, 1, 0, 0, 0, 0, time.UTC)
+			now := time.Date(2021, 1, 1, 0, 30, 0, 0, time.UTC)
+
+			due, err := c.shouldFire(schedule, lastRun, now)
+			Expect(err).ToNot(HaveOccurred())
+			Expect(due).To(BeFalse())
+		})
+
+		It("returns an error for an invalid cron expression", func() {
+			invalid := &vmsnapshotv1alpha1.VirtualMachineSnapshotSchedule{
+				Spec: vmsnapshotv1alpha1.VirtualMachineSnapshotScheduleSpec{Schedule: "not-a-cron-expression"},
+			}
+
+			_, err := c.shouldFire(invalid, time.Now(), time.Now())
+			Expect(err).To(HaveOccurred())
+		})
+	})
+
+	Context("pruneSnapshots", func() {
+		now := time.Date(2021, 1, 10, 0, 0, 0, 0, time.UTC)
+
+		snapshotAt := func(name string, age time.Duration) vmsnapshotv1alpha1.VirtualMachineSnapshot {
+			return vmsnapshotv1alpha1.VirtualMachineSnapshot{
+				ObjectMeta: metav1.ObjectMeta{
+					Name:              name,
+					CreationTimestamp: metav1.NewTime(now.Add(-age)),
+				},
+			}
+		}
+
+		It("keeps the newest MaxSnapshots and deletes the rest", func() {
+			max := int32(2)
+			schedule := &vmsnapshotv1alpha1.VirtualMachineSnapshotSchedule{
+				Spec: vmsnapshotv1alpha1.VirtualMachineSnapshotScheduleSpec{
+					Retention: vmsnapshotv1alpha1.VirtualMachineSnapshotScheduleRetention{MaxSnapshots: &max},
+				},
+			}
+			snapshots := []vmsnapshotv1alpha1.VirtualMachineSnapshot{
+				snapshotAt("oldest", 3*time.Hour),
+				snapshotAt("middle", 2*time.Hour),
+				snapshotAt("newest", 1*time.Hour),
+			}
+
+			toDelete := c.pruneSnapshots(schedule, snapshots, now)
+			Expect(toDelete).To(HaveLen(1))
+			Expect(toDelete[0].Name).To(Equal("oldest"))
+		})
+
+		It("deletes everything older than MaxAge", func() {
+			schedule := &vmsnapshotv1alpha1.VirtualMachineSnapshotSchedule{
+				Spec: vmsnapshotv1alpha1.VirtualMachineSnapshotScheduleSpec{
+					Retention: vmsnapshotv1alpha1.VirtualMachineSnapshotScheduleRetention{
+						MaxAge: &metav1.Duration{Duration: 90 * time.Minute},
+					},
+				},
+			}
+			snapshots := []vmsnapshotv1alpha1.VirtualMachineSnapshot{
+				snapshotAt("too-old", 2*time.Hour),
+				snapshotAt("still-fresh", 30*time.Minute),
+			}
+
+			toDelete := c.pruneSnapshots(schedule, snapshots, now)
+			Expect(toDelete).To(HaveLen(1))
+			Expect(toDelete[0].Name).To(Equal("too-old"))
+		})
+
+		It("does nothing when retention is unset", func() {
+			schedule := &vmsnapshotv1alpha1.VirtualMachineSnapshotSchedule{}
+			snapshots := []vmsnapshotv1alpha1.VirtualMachineSnapshot{
+				snapshotAt("a", 3*time.Hour),
+				snapshotAt("b", 1*time.Hour),
+			}
+
+			Expect(c.pruneSnapshots(schedule, snapshots, now)).To(BeEmpty())
+		})
+	})
+})
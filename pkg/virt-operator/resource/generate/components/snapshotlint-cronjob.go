@@ -0,0 +1,75 @@
+/*
+ * This file is part of the KubeVirt project
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ *
+ * Copyright 2018 Red Hat, Inc.
+ *
+ */
+
+package components
+
+import (
+	batchv1 "k8s.io/api/batch/v1"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+const (
+	// SnapshotLintCronJobName is the name of the in-cluster snapshot hygiene scan.
+	SnapshotLintCronJobName = "virt-snapshot-lint"
+
+	// defaultSnapshotLintSchedule runs the scan once an hour.
+	defaultSnapshotLintSchedule = "13 * * * *"
+)
+
+// NewSnapshotLintCronJob returns a CronJob that runs "virtctl lint-snapshots
+// --all-namespaces --output-json" on a schedule, so operators get a continuous audit of
+// snapshot/restore hygiene across the cluster rather than only at admission time.
+func NewSnapshotLintCronJob(namespace, image, imagePullPolicy, serviceAccountName string) *batchv1.CronJob {
+	return &batchv1.CronJob{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:      SnapshotLintCronJobName,
+			Namespace: namespace,
+		},
+		Spec: batchv1.CronJobSpec{
+			Schedule:                   defaultSnapshotLintSchedule,
+			ConcurrencyPolicy:          batchv1.ForbidConcurrent,
+			SuccessfulJobsHistoryLimit: pointer(int32(3)),
+			FailedJobsHistoryLimit:     pointer(int32(3)),
+			JobTemplate: batchv1.JobTemplateSpec{
+				Spec: batchv1.JobSpec{
+					Template: corev1.PodTemplateSpec{
+						Spec: corev1.PodSpec{
+							ServiceAccountName: serviceAccountName,
+							RestartPolicy:      corev1.RestartPolicyOnFailure,
+							Containers: []corev1.Container{
+								{
+									Name:            "lint-snapshots",
+									Image:           image,
+									ImagePullPolicy: corev1.PullPolicy(imagePullPolicy),
+									Command:         []string{"virtctl"},
+									Args:            []string{"lint-snapshots", "--all-namespaces", "--output-json"},
+								},
+							},
+						},
+					},
+				},
+			},
+		},
+	}
+}
+
+func pointer(i int32) *int32 {
+	return &i
+}
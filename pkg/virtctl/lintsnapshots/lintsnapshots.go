@@ -0,0 +1,283 @@
+/*
+ * This file is part of the KubeVirt project
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ *
+ * Copyright 2018 Red Hat, Inc.
+ *
+ */
+
+// Package lintsnapshots implements "virtctl lint-snapshots", which scans every
+// VirtualMachineSnapshot and VirtualMachineRestore in the cluster (or a single namespace)
+// and reports ones that are invalid or orphaned. It reuses the existence checks of the
+// validation package that the admission webhook also uses, but not the webhook's
+// create-time checks on whether a VM is running or a snapshot is Ready.
+package lintsnapshots
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"time"
+
+	snapshotclient "github.com/kubernetes-csi/external-snapshotter/client/v4/clientset/versioned"
+	"github.com/spf13/cobra"
+
+	"k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	k8sfield "k8s.io/apimachinery/pkg/util/validation/field"
+	"k8s.io/client-go/tools/clientcmd"
+
+	vmsnapshotv1alpha1 "kubevirt.io/client-go/apis/snapshot/v1alpha1"
+	"kubevirt.io/client-go/kubecli"
+	"kubevirt.io/kubevirt/pkg/virt-controller/snapshot/validation"
+	"kubevirt.io/kubevirt/pkg/virtctl/templates"
+)
+
+const (
+	// COMMAND_LINT_SNAPSHOTS is the virtctl subcommand name.
+	COMMAND_LINT_SNAPSHOTS = "lint-snapshots"
+
+	// stuckInProgressAfter flags a snapshot as stuck if it has been InProgress longer than this.
+	stuckInProgressAfter = 6 * time.Hour
+)
+
+// Finding describes a single invalid or orphaned snapshot-related object.
+type Finding struct {
+	Namespace string `json:"namespace"`
+	Name      string `json:"name"`
+	Kind      string `json:"kind"`
+	Reason    string `json:"reason"`
+}
+
+type command struct {
+	clientConfig  clientcmd.ClientConfig
+	allNamespaces bool
+	outputJSON    bool
+}
+
+// NewCommand returns the "lint-snapshots" cobra command.
+func NewCommand(clientConfig clientcmd.ClientConfig) *cobra.Command {
+	c := command{clientConfig: clientConfig}
+	cmd := &cobra.Command{
+		Use:     COMMAND_LINT_SNAPSHOTS,
+		Short:   "Report invalid or orphaned VirtualMachineSnapshots and VirtualMachineRestores.",
+		Example: usage(),
+		Args:    cobra.NoArgs,
+		RunE:    c.run,
+	}
+	cmd.Flags().BoolVarP(&c.allNamespaces, "all-namespaces", "A", false, "lint snapshots across all namespaces")
+	cmd.Flags().BoolVar(&c.outputJSON, "output-json", false, "print findings as JSON instead of a human-readable table")
+	cmd.SetUsageTemplate(templates.UsageTemplate())
+	return cmd
+}
+
+func usage() string {
+	usage := `  # Lint VirtualMachineSnapshots in the current namespace:
+  {{ProgramName}} lint-snapshots
+
+  # Lint across the whole cluster, emitting JSON for downstream tooling:
+  {{ProgramName}} lint-snapshots --all-namespaces --output-json`
+	return usage
+}
+
+func (c *command) run(cmd *cobra.Command, args []string) error {
+	namespace, _, err := c.clientConfig.Namespace()
+	if err != nil {
+		return err
+	}
+
+	client, err := kubecli.GetKubevirtClientFromClientConfig(c.clientConfig)
+	if err != nil {
+		return err
+	}
+
+	restConfig, err := c.clientConfig.ClientConfig()
+	if err != nil {
+		return err
+	}
+
+	snapClient, err := snapshotclient.NewForConfig(restConfig)
+	if err != nil {
+		return err
+	}
+
+	if c.allNamespaces {
+		namespace = metav1.NamespaceAll
+	}
+
+	findings, err := lint(client, snapClient, namespace)
+	if err != nil {
+		return err
+	}
+
+	if c.outputJSON {
+		return c.printJSON(cmd, findings)
+	}
+	return c.printTable(cmd, findings)
+}
+
+// lint validates every VirtualMachineSnapshot and VirtualMachineRestore in namespace
+// (metav1.NamespaceAll for every namespace). It checks for a missing source VM, a dangling
+// VolumeSnapshotContent, and a snapshot stuck InProgress for too long. Unlike the admission
+// webhook, it never flags a snapshot's source VM for merely being running again later —
+// that's normal lifecycle (stop VM, snapshot it, start it again), not a hygiene problem.
+func lint(client kubecli.KubevirtClient, snapshotClient snapshotclient.Interface, namespace string) ([]Finding, error) {
+	var findings []Finding
+
+	snapshotFindings, err := lintSnapshots(client, snapshotClient, namespace)
+	if err != nil {
+		return nil, err
+	}
+	findings = append(findings, snapshotFindings...)
+
+	restoreFindings, err := lintRestores(client, namespace)
+	if err != nil {
+		return nil, err
+	}
+	findings = append(findings, restoreFindings...)
+
+	return findings, nil
+}
+
+func lintSnapshots(client kubecli.KubevirtClient, snapshotClient snapshotclient.Interface, namespace string) ([]Finding, error) {
+	snapshots, err := client.VirtualMachineSnapshot(namespace).List(&metav1.ListOptions{})
+	if err != nil {
+		return nil, fmt.Errorf("failed to list VirtualMachineSnapshots: %v", err)
+	}
+
+	var findings []Finding
+
+	for i := range snapshots.Items {
+		snapshot := &snapshots.Items[i]
+		sourceField := k8sfield.NewPath("spec", "source")
+
+		source := snapshot.Spec.Source
+		switch {
+		case source.VirtualMachineName != nil:
+			causes, err := validation.ValidateSourceVMExists(client, sourceField.Child("virtualMachineName"), snapshot.Namespace, *source.VirtualMachineName)
+			if err != nil {
+				return nil, err
+			}
+			findings = append(findings, causesToFindings(snapshot.Namespace, snapshot.Name, "VirtualMachineSnapshot", causes)...)
+		case source.VirtualMachineInstanceName != nil:
+			causes, err := validation.ValidateSourceVMIExists(client, sourceField.Child("virtualMachineInstanceName"), snapshot.Namespace, *source.VirtualMachineInstanceName)
+			if err != nil {
+				return nil, err
+			}
+			findings = append(findings, causesToFindings(snapshot.Namespace, snapshot.Name, "VirtualMachineSnapshot", causes)...)
+		case len(source.PersistentVolumeClaims) > 0:
+			for idx, pvcName := range source.PersistentVolumeClaims {
+				causes, err := validation.ValidateSourcePVCExists(client, sourceField.Child("persistentVolumeClaims").Index(idx), snapshot.Namespace, pvcName)
+				if err != nil {
+					return nil, err
+				}
+				findings = append(findings, causesToFindings(snapshot.Namespace, snapshot.Name, "VirtualMachineSnapshot", causes)...)
+			}
+		}
+
+		if snapshot.Status != nil {
+			for _, volumeStatus := range snapshot.Status.VolumeSnapshotStatuses {
+				if volumeStatus.ContentName == nil {
+					continue
+				}
+
+				_, err := snapshotClient.SnapshotV1().VolumeSnapshotContents().Get(context.Background(), *volumeStatus.ContentName, metav1.GetOptions{})
+				if err != nil && !errors.IsNotFound(err) {
+					return nil, fmt.Errorf("failed to get VolumeSnapshotContent %q: %v", *volumeStatus.ContentName, err)
+				}
+
+				causes := validation.ValidateVolumeSnapshotContentExists(err == nil, k8sfield.NewPath("status", "volumeSnapshotStatuses").Key(volumeStatus.Name), *volumeStatus.ContentName)
+				findings = append(findings, causesToFindings(snapshot.Namespace, snapshot.Name, "VirtualMachineSnapshot", causes)...)
+			}
+		}
+
+		if snapshot.Status != nil && snapshot.Status.Phase == vmsnapshotv1alpha1.InProgress &&
+			time.Since(snapshot.CreationTimestamp.Time) > stuckInProgressAfter {
+			findings = append(findings, Finding{
+				Namespace: snapshot.Namespace,
+				Name:      snapshot.Name,
+				Kind:      "VirtualMachineSnapshot",
+				Reason:    fmt.Sprintf("stuck InProgress for more than %s", stuckInProgressAfter),
+			})
+		}
+	}
+
+	return findings, nil
+}
+
+func lintRestores(client kubecli.KubevirtClient, namespace string) ([]Finding, error) {
+	restores, err := client.VirtualMachineRestore(namespace).List(&metav1.ListOptions{})
+	if err != nil {
+		return nil, fmt.Errorf("failed to list VirtualMachineRestores: %v", err)
+	}
+
+	var findings []Finding
+
+	for i := range restores.Items {
+		restore := &restores.Items[i]
+		field := k8sfield.NewPath("spec", "virtualMachineSnapshotName")
+
+		causes, err := validation.ValidateSourceSnapshotExists(client, field, restore.Namespace, restore.Spec.VirtualMachineSnapshotName)
+		if err != nil {
+			return nil, err
+		}
+		findings = append(findings, causesToFindings(restore.Namespace, restore.Name, "VirtualMachineRestore", causes)...)
+
+		if restore.Status != nil && restore.Status.Phase == vmsnapshotv1alpha1.InProgress &&
+			time.Since(restore.CreationTimestamp.Time) > stuckInProgressAfter {
+			findings = append(findings, Finding{
+				Namespace: restore.Namespace,
+				Name:      restore.Name,
+				Kind:      "VirtualMachineRestore",
+				Reason:    fmt.Sprintf("stuck InProgress for more than %s", stuckInProgressAfter),
+			})
+		}
+	}
+
+	return findings, nil
+}
+
+func causesToFindings(namespace, name, kind string, causes []metav1.StatusCause) []Finding {
+	findings := make([]Finding, 0, len(causes))
+	for _, cause := range causes {
+		findings = append(findings, Finding{
+			Namespace: namespace,
+			Name:      name,
+			Kind:      kind,
+			Reason:    cause.Message,
+		})
+	}
+	return findings
+}
+
+func (c *command) printJSON(cmd *cobra.Command, findings []Finding) error {
+	encoded, err := json.MarshalIndent(findings, "", "  ")
+	if err != nil {
+		return err
+	}
+	cmd.Println(string(encoded))
+	return nil
+}
+
+func (c *command) printTable(cmd *cobra.Command, findings []Finding) error {
+	if len(findings) == 0 {
+		cmd.Println("No issues found.")
+		return nil
+	}
+
+	for _, finding := range findings {
+		cmd.Printf("%s\t%s/%s\t%s\n", finding.Kind, finding.Namespace, finding.Name, finding.Reason)
+	}
+	return nil
+}